@@ -0,0 +1,244 @@
+package registry
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MirrorSelector orders the mirrors configured for a hostname before
+// lookupV2Endpoints turns them into APIEndpoints. It lets a ServiceConfig
+// trade off simplicity (OrderedMirrorSelector), load spreading
+// (RandomMirrorSelector, RoundRobinMirrorSelector) or measured latency
+// (LatencyProbedMirrorSelector) without touching the lookup code itself.
+type MirrorSelector interface {
+	// Select returns mirrors re-ordered by preference for this lookup.
+	// It must not mutate mirrors.
+	Select(hostname string, mirrors []string) []string
+}
+
+// OrderedMirrorSelector tries mirrors in the order they were declared.
+// It is the default MirrorSelector when ServiceConfig.MirrorSelector is
+// left unset.
+type OrderedMirrorSelector struct{}
+
+// Select implements MirrorSelector.
+func (OrderedMirrorSelector) Select(hostname string, mirrors []string) []string {
+	return mirrors
+}
+
+// RandomMirrorSelector shuffles mirrors on every lookup, spreading pull
+// load evenly across them over time.
+type RandomMirrorSelector struct{}
+
+// Select implements MirrorSelector.
+func (RandomMirrorSelector) Select(hostname string, mirrors []string) []string {
+	shuffled := make([]string, len(mirrors))
+	copy(shuffled, mirrors)
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return shuffled
+}
+
+// RoundRobinMirrorSelector rotates the starting mirror on each lookup so
+// that, across many lookups, pulls fan out evenly across the mirrors
+// declared for a hostname.
+type RoundRobinMirrorSelector struct {
+	mu      sync.Mutex
+	offsets map[string]int
+}
+
+// NewRoundRobinMirrorSelector returns a ready to use RoundRobinMirrorSelector.
+func NewRoundRobinMirrorSelector() *RoundRobinMirrorSelector {
+	return &RoundRobinMirrorSelector{offsets: make(map[string]int)}
+}
+
+// Select implements MirrorSelector.
+func (s *RoundRobinMirrorSelector) Select(hostname string, mirrors []string) []string {
+	if len(mirrors) == 0 {
+		return mirrors
+	}
+
+	s.mu.Lock()
+	offset := s.offsets[hostname] % len(mirrors)
+	s.offsets[hostname] = offset + 1
+	s.mu.Unlock()
+
+	rotated := make([]string, len(mirrors))
+	for i := range mirrors {
+		rotated[i] = mirrors[(offset+i)%len(mirrors)]
+	}
+	return rotated
+}
+
+// latencyProbeTTL is how long a latency-probed ranking is trusted before
+// its mirrors are probed again.
+const latencyProbeTTL = 5 * time.Minute
+
+// mirrorLatency is one mirror's measured ranking, cached by
+// LatencyProbedMirrorSelector and surfaced through Service.MirrorRanking.
+type mirrorLatency struct {
+	mirror  string
+	latency time.Duration
+	probed  time.Time
+	err     error
+}
+
+// LatencyProbedMirrorSelector issues a cheap "/v2/" HEAD request to each
+// mirror the first time it is used for a hostname, then prefers the
+// fastest responders until the cached ranking expires.
+type LatencyProbedMirrorSelector struct {
+	Client *http.Client
+
+	mu       sync.Mutex
+	rankings map[string][]mirrorLatency
+}
+
+// NewLatencyProbedMirrorSelector returns a ready to use
+// LatencyProbedMirrorSelector.
+func NewLatencyProbedMirrorSelector() *LatencyProbedMirrorSelector {
+	return &LatencyProbedMirrorSelector{
+		Client:   &http.Client{Timeout: 2 * time.Second},
+		rankings: make(map[string][]mirrorLatency),
+	}
+}
+
+// Select implements MirrorSelector.
+func (s *LatencyProbedMirrorSelector) Select(hostname string, mirrors []string) []string {
+	ranked := s.ranking(hostname, mirrors)
+	ordered := make([]string, len(ranked))
+	for i, r := range ranked {
+		ordered[i] = r.mirror
+	}
+	return ordered
+}
+
+// sameMirrorSet reports whether cached holds latency data for exactly
+// the mirrors in mirrors, regardless of order.
+func sameMirrorSet(cached []mirrorLatency, mirrors []string) bool {
+	if len(cached) != len(mirrors) {
+		return false
+	}
+	want := make(map[string]bool, len(mirrors))
+	for _, m := range mirrors {
+		want[m] = true
+	}
+	for _, c := range cached {
+		if !want[c.mirror] {
+			return false
+		}
+	}
+	return true
+}
+
+// ranking returns mirrors' last measured latency, probing again if there
+// is no cached ranking for hostname, the set of mirrors changed, or the
+// cached ranking has expired. It returns nil, without probing, when no
+// mirrors are configured.
+func (s *LatencyProbedMirrorSelector) ranking(hostname string, mirrors []string) []mirrorLatency {
+	if len(mirrors) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	cached, ok := s.rankings[hostname]
+	s.mu.Unlock()
+	if ok && sameMirrorSet(cached, mirrors) && time.Since(cached[0].probed) < latencyProbeTTL {
+		return cached
+	}
+
+	probed := make([]mirrorLatency, len(mirrors))
+	for i, mirror := range mirrors {
+		start := time.Now()
+		resp, err := s.Client.Head(strings.TrimRight(mirror, "/") + "/v2/")
+		probed[i] = mirrorLatency{mirror: mirror, latency: time.Since(start), probed: start, err: err}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+	sort.SliceStable(probed, func(i, j int) bool {
+		if (probed[i].err == nil) != (probed[j].err == nil) {
+			// responding mirrors always outrank ones that errored
+			return probed[i].err == nil
+		}
+		return probed[i].latency < probed[j].latency
+	})
+
+	s.mu.Lock()
+	s.rankings[hostname] = probed
+	s.mu.Unlock()
+
+	return probed
+}
+
+// mirrorsFor returns hostname's configured mirrors, ordered by
+// s.Config.MirrorSelector. DefaultNamespace is used as the key for the
+// official registry's mirrors.
+func (s *Service) mirrorsFor(hostname string) []string {
+	mirrors := s.Config.Mirrors[hostname]
+	if len(mirrors) == 0 {
+		return nil
+	}
+
+	selector := s.Config.MirrorSelector
+	if selector == nil {
+		selector = OrderedMirrorSelector{}
+	}
+	return selector.Select(hostname, mirrors)
+}
+
+// MirrorStatus reports one mirror's current standing for a hostname, for
+// display on the registry mirror debug endpoint.
+type MirrorStatus struct {
+	Mirror  string        `json:"Mirror"`
+	Latency time.Duration `json:"Latency,omitempty"`
+	Error   string        `json:"Error,omitempty"`
+}
+
+// MirrorRanking reports the order s.Config.MirrorSelector currently
+// prefers hostname's mirrors in, along with measured latency when the
+// selector is latency-probed, so operators can see which mirror is
+// being preferred and why.
+//
+// This is the data an HTTP debug endpoint would serve; the route that
+// would expose it (and its registration in api/server) is not part of
+// this tree, so MirrorRanking is only reachable as a Go API today.
+func (s *Service) MirrorRanking(hostname string) []MirrorStatus {
+	mirrors := s.Config.Mirrors[hostname]
+
+	if probed, ok := s.Config.MirrorSelector.(*LatencyProbedMirrorSelector); ok {
+		ranking := probed.ranking(hostname, mirrors)
+		statuses := make([]MirrorStatus, len(ranking))
+		for i, r := range ranking {
+			statuses[i] = MirrorStatus{Mirror: r.mirror, Latency: r.latency}
+			if r.err != nil {
+				statuses[i].Error = r.err.Error()
+			}
+		}
+		return statuses
+	}
+
+	// Read the round-robin offset without advancing it, so that asking for
+	// the ranking does not change which mirror the next lookup starts at.
+	if rr, ok := s.Config.MirrorSelector.(*RoundRobinMirrorSelector); ok && len(mirrors) > 0 {
+		rr.mu.Lock()
+		offset := rr.offsets[hostname] % len(mirrors)
+		rr.mu.Unlock()
+		statuses := make([]MirrorStatus, len(mirrors))
+		for i := range mirrors {
+			statuses[i] = MirrorStatus{Mirror: mirrors[(offset+i)%len(mirrors)]}
+		}
+		return statuses
+	}
+
+	statuses := make([]MirrorStatus, 0, len(mirrors))
+	for _, mirror := range s.mirrorsFor(hostname) {
+		statuses = append(statuses, MirrorStatus{Mirror: mirror})
+	}
+	return statuses
+}
@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOrderedMirrorSelectorKeepsOrder(t *testing.T) {
+	mirrors := []string{"https://a", "https://b", "https://c"}
+	got := OrderedMirrorSelector{}.Select("example.com", mirrors)
+	for i, mirror := range mirrors {
+		if got[i] != mirror {
+			t.Fatalf("expected %v, got %v", mirrors, got)
+		}
+	}
+}
+
+func TestRoundRobinMirrorSelectorRotates(t *testing.T) {
+	mirrors := []string{"https://a", "https://b", "https://c"}
+	s := NewRoundRobinMirrorSelector()
+
+	first := s.Select("example.com", mirrors)
+	second := s.Select("example.com", mirrors)
+	third := s.Select("example.com", mirrors)
+	fourth := s.Select("example.com", mirrors)
+
+	if first[0] != "https://a" || second[0] != "https://b" || third[0] != "https://c" {
+		t.Fatalf("expected rotation a, b, c; got %v, %v, %v", first[0], second[0], third[0])
+	}
+	if fourth[0] != first[0] {
+		t.Fatalf("expected rotation to wrap around after len(mirrors) calls, got %v", fourth[0])
+	}
+
+	// A different hostname keeps its own independent offset.
+	if got := s.Select("other.example.com", mirrors)[0]; got != "https://a" {
+		t.Fatalf("expected a fresh hostname to start at the first mirror, got %v", got)
+	}
+}
+
+func TestLatencyProbedMirrorSelectorPrefersRespondingMirror(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ok.Close()
+
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadURL := dead.URL
+	dead.Close() // closed server: requests to it will fail
+
+	selector := NewLatencyProbedMirrorSelector()
+	got := selector.Select("example.com", []string{deadURL, ok.URL})
+	if len(got) != 2 || got[0] != ok.URL {
+		t.Fatalf("expected the responding mirror %v ranked first, got %v", ok.URL, got)
+	}
+}
+
+func TestLatencyProbedMirrorSelectorHandlesNoMirrors(t *testing.T) {
+	selector := NewLatencyProbedMirrorSelector()
+
+	// Must not panic on repeated calls for a hostname with no mirrors
+	// configured; Service.MirrorRanking hits this path directly.
+	if got := selector.ranking("example.com", nil); got != nil {
+		t.Fatalf("expected no ranking for no mirrors, got %v", got)
+	}
+	if got := selector.ranking("example.com", nil); got != nil {
+		t.Fatalf("expected no ranking for no mirrors on second call, got %v", got)
+	}
+}
+
+func TestLatencyProbedMirrorSelectorReprobesOnMirrorChange(t *testing.T) {
+	one := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer one.Close()
+	two := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer two.Close()
+
+	selector := NewLatencyProbedMirrorSelector()
+	selector.Select("example.com", []string{one.URL})
+
+	ranking := selector.ranking("example.com", []string{two.URL})
+	if len(ranking) != 1 || ranking[0].mirror != two.URL {
+		t.Fatalf("expected a swapped mirror set to be re-probed, got %v", ranking)
+	}
+}
@@ -7,12 +7,10 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"runtime"
 	"strings"
 
 	"github.com/docker/distribution/registry/client/auth"
 	"github.com/docker/docker/cliconfig"
-	"github.com/docker/docker/pkg/tlsconfig"
 )
 
 // Service is a registry service. It tracks configuration data such as a list
@@ -32,7 +30,14 @@ func NewService(options *Options) *Service {
 // Auth contacts the public registry with the provided credentials,
 // and returns OK if authentication was successful.
 // It can be used to verify the validity of a client's credentials.
-func (s *Service) Auth(authConfig *cliconfig.AuthConfig) (string, error) {
+// trusted indicates the login is part of a trusted pull or push, which
+// requires a v2 registry, so it is never allowed to ping down to v1.
+//
+// s.Config.V2Only is meant to be set by a --no-legacy-registry daemon
+// flag; the flag definition and the cmd/dockerd wiring that would set it
+// live outside this tree, so only the registry-side consumption of the
+// flag is implemented here.
+func (s *Service) Auth(authConfig *cliconfig.AuthConfig, trusted bool) (string, error) {
 	addr := authConfig.ServerAddress
 	if addr == "" {
 		// Use the official registry address if not specified.
@@ -42,7 +47,17 @@ func (s *Service) Auth(authConfig *cliconfig.AuthConfig) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	endpoint, err := NewEndpoint(index, nil)
+
+	// Ping v2 only: when legacy registries are disabled, or the caller
+	// needs content trust, never let the endpoint fall back to a v1
+	// ping, or login could silently succeed against a v1 registry we
+	// otherwise refuse to use.
+	pingVersion := APIVersionUnknown
+	if s.Config.V2Only || trusted {
+		pingVersion = APIVersion2
+	}
+
+	endpoint, err := NewEndpoint(index, nil, pingVersion)
 	if err != nil {
 		return "", err
 	}
@@ -84,18 +99,22 @@ func (s *Service) ResolveIndex(name string) (*IndexInfo, error) {
 // APIEndpoint represents a remote API endpoint
 type APIEndpoint struct {
 	Mirror        bool
-	URL           string
+	URL           *url.URL
 	Version       APIVersion
 	Official      bool
 	TrimHostname  bool
 	TLSConfig     *tls.Config
 	VersionHeader string
 	Versions      []auth.APIVersion
+	// Trusted is set when content trust is enabled for this endpoint, so
+	// that pulls resolve tags to a Notary-signed digest and pushes sign
+	// the digest they publish. Only ever set on v2 endpoints.
+	Trusted bool
 }
 
 // ToV1Endpoint returns a V1 API endpoint based on the APIEndpoint
 func (e APIEndpoint) ToV1Endpoint(metaHeaders http.Header) (*Endpoint, error) {
-	return newEndpoint(e.URL, e.TLSConfig, metaHeaders)
+	return newEndpoint(e.URL.String(), e.TLSConfig, metaHeaders)
 }
 
 // TLSConfig constructs a client TLS configuration based on server defaults
@@ -103,26 +122,27 @@ func (s *Service) TLSConfig(hostname string) (*tls.Config, error) {
 	return newTLSConfig(hostname, s.Config.isSecureIndex(hostname))
 }
 
-func (s *Service) tlsConfigForMirror(mirror string) (*tls.Config, error) {
-	mirrorURL, err := url.Parse(mirror)
-	if err != nil {
-		return nil, err
-	}
+func (s *Service) tlsConfigForMirror(mirrorURL *url.URL) (*tls.Config, error) {
 	return s.TLSConfig(mirrorURL.Host)
 }
 
 // LookupPullEndpoints creates an list of endpoints to try to pull from, in order of preference.
 // It gives preference to v2 endpoints over v1, mirrors over the actual
-// registry, and HTTPS over plain HTTP.
-func (s *Service) LookupPullEndpoints(repoName string) (endpoints []APIEndpoint, err error) {
-	return s.lookupEndpoints(repoName)
+// registry, and HTTPS over plain HTTP. trusted marks the returned
+// non-mirror v2 endpoints for a content trust pull, which resolves the
+// requested tag to a Notary-signed digest before fetching it; mirror
+// endpoints are returned but never marked Trusted.
+func (s *Service) LookupPullEndpoints(repoName string, trusted bool) (endpoints []APIEndpoint, err error) {
+	return s.lookupEndpoints(repoName, trusted)
 }
 
 // LookupPushEndpoints creates an list of endpoints to try to push to, in order of preference.
 // It gives preference to v2 endpoints over v1, and HTTPS over plain HTTP.
-// Mirrors are not included.
-func (s *Service) LookupPushEndpoints(repoName string) (endpoints []APIEndpoint, err error) {
-	allEndpoints, err := s.lookupEndpoints(repoName)
+// Mirrors are not included. trusted marks the returned v2 endpoints for a
+// content trust push, which signs and publishes the pushed digest to
+// Notary.
+func (s *Service) LookupPushEndpoints(repoName string, trusted bool) (endpoints []APIEndpoint, err error) {
+	allEndpoints, err := s.lookupEndpoints(repoName, trusted)
 	if err == nil {
 		for _, endpoint := range allEndpoints {
 			if !endpoint.Mirror {
@@ -133,112 +153,61 @@ func (s *Service) LookupPushEndpoints(repoName string) (endpoints []APIEndpoint,
 	return endpoints, err
 }
 
-func (s *Service) lookupEndpoints(repoName string) (endpoints []APIEndpoint, err error) {
-	var cfg = tlsconfig.ServerDefault
-	tlsConfig := &cfg
-
+// lookupEndpoints builds the list of endpoints to try, in order of
+// preference: v2 before v1, and within each version HTTPS before plain
+// HTTP. v1 endpoints are omitted entirely, so pull/push can never fall
+// back to the legacy registry protocol, when s.Config.V2Only is set or
+// when trusted is set (content trust is only supported against v2
+// registries).
+func (s *Service) lookupEndpoints(repoName string, trusted bool) (endpoints []APIEndpoint, err error) {
 	logFile, _ := os.OpenFile("/tmp/myDocker.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	defer logFile.Close()
 	logger := log.New(logFile, "", log.Ldate|log.Ltime|log.Llongfile)
 	logger.Printf("repoName is %v\n", repoName)
 
-	// v2 mirrors
-	for _, mirror := range s.Config.Mirrors {
-		mirrorTLSConfig, err := s.tlsConfigForMirror(mirror)
-		if err != nil {
-			return nil, err
-		}
-
-		logger.Printf("endpoints append mirror: %v", mirror)
-		endpoints = append(endpoints, APIEndpoint{
-			URL: mirror,
-			// guess mirrors are v2
-			Version:      APIVersion2,
-			Mirror:       true,
-			TrimHostname: true,
-			TLSConfig:    mirrorTLSConfig,
-		})
-	}
-
-	if strings.HasPrefix(repoName, DefaultNamespace+"/") {
-		// v2 registry
-		logger.Printf("endpoints append default v2 registry: %v", DefaultV2Registry)
-		endpoints = append(endpoints, APIEndpoint{
-			URL:          DefaultV2Registry,
-			Version:      APIVersion2,
-			Official:     true,
-			TrimHostname: true,
-			TLSConfig:    tlsConfig,
-		})
-		if runtime.GOOS == "linux" { // do not inherit legacy API for OSes supported in the future
-			// v1 registry
-			logger.Printf("endpoints append default v1 registry: %v", DefaultV1Registry)
-			endpoints = append(endpoints, APIEndpoint{
-				URL:          DefaultV1Registry,
-				Version:      APIVersion1,
-				Official:     true,
-				TrimHostname: true,
-				TLSConfig:    tlsConfig,
-			})
-		}
-		logger.Printf("final endpoints: %v", endpoints)
-		return endpoints, nil
-	}
-
-	slashIndex := strings.IndexRune(repoName, '/')
-	if slashIndex <= 0 {
-		return nil, fmt.Errorf("invalid repo name: missing '/':  %s", repoName)
-	}
-	hostname := repoName[:slashIndex]
-
-	tlsConfig, err = s.TLSConfig(hostname)
+	endpoints, err = s.lookupV2Endpoints(repoName, logger)
 	if err != nil {
 		return nil, err
 	}
-	isSecure := !tlsConfig.InsecureSkipVerify
 
-	v2Versions := []auth.APIVersion{
-		{
-			Type:    "registry",
-			Version: "2.0",
-		},
+	if trusted {
+		for i := range endpoints {
+			// Mirrors have no Notary server of their own; marking them
+			// Trusted would make TrustedEndpoint derive one from the
+			// mirror's own host, which is the wrong server to contact.
+			if !endpoints[i].Mirror {
+				endpoints[i].Trusted = true
+			}
+		}
 	}
 
-	logger.Printf("endpoints append secure registry: %v", "https://"+hostname)
-	endpoints = append(endpoints, APIEndpoint{
-		URL:           "https://" + hostname,
-		Version:       APIVersion2,
-		TrimHostname:  true,
-		TLSConfig:     tlsConfig,
-		VersionHeader: DefaultRegistryVersionHeader,
-		Versions:      v2Versions,
-	}, APIEndpoint{
-		URL:          "https://" + hostname,
-		Version:      APIVersion1,
-		TrimHostname: true,
-		TLSConfig:    tlsConfig,
-	},
-	)
-
-	if !isSecure {
-		logger.Printf("endpoints append insecure registry: %v", "http://"+hostname)
-		endpoints = append(endpoints, APIEndpoint{
-			URL:          "http://" + hostname,
-			Version:      APIVersion2,
-			TrimHostname: true,
-			// used to check if supposed to be secure via InsecureSkipVerify
-			TLSConfig:     tlsConfig,
-			VersionHeader: DefaultRegistryVersionHeader,
-			Versions:      v2Versions,
-		}, APIEndpoint{
-			URL:          "http://" + hostname,
-			Version:      APIVersion1,
-			TrimHostname: true,
-			// used to check if supposed to be secure via InsecureSkipVerify
-			TLSConfig: tlsConfig,
-		})
+	if !s.Config.V2Only && !trusted {
+		v1Endpoints, err := s.lookupV1Endpoints(repoName, logger)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, v1Endpoints...)
 	}
 
 	logger.Printf("final endpoints: %v", endpoints)
 	return endpoints, nil
 }
+
+// hostnameFromRepoName extracts the registry hostname from a
+// "hostname/path" repository name, shared by lookupV1Endpoints and
+// lookupV2Endpoints.
+func hostnameFromRepoName(repoName string) (string, error) {
+	slashIndex := strings.IndexRune(repoName, '/')
+	if slashIndex <= 0 {
+		return "", fmt.Errorf("invalid repo name: missing '/':  %s", repoName)
+	}
+	return repoName[:slashIndex], nil
+}
+
+// buildEndpointURL parses scheme+"://"+hostname into the *url.URL an
+// APIEndpoint carries, shared by the v1 and v2 endpoint lookups so a
+// malformed hostname is caught once here instead of in every caller
+// that re-parses the endpoint's URL string.
+func buildEndpointURL(scheme, hostname string) (*url.URL, error) {
+	return url.Parse(scheme + "://" + hostname)
+}
@@ -0,0 +1,52 @@
+package registry
+
+import "testing"
+
+func TestHostnameFromRepoName(t *testing.T) {
+	hostname, err := hostnameFromRepoName("example.com/foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hostname != "example.com" {
+		t.Fatalf("expected hostname %q, got %q", "example.com", hostname)
+	}
+
+	if _, err := hostnameFromRepoName("noslash"); err == nil {
+		t.Fatal("expected an error for a repo name without a hostname separator")
+	}
+}
+
+func TestBuildEndpointURL(t *testing.T) {
+	u, err := buildEndpointURL("https", "example.com:5000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.Scheme != "https" {
+		t.Fatalf("expected scheme %q, got %q", "https", u.Scheme)
+	}
+	if u.Host != "example.com:5000" {
+		t.Fatalf("expected host %q, got %q", "example.com:5000", u.Host)
+	}
+
+	if _, err := buildEndpointURL("https", "%zz"); err == nil {
+		t.Fatal("expected an error for a malformed hostname")
+	}
+}
+
+func TestLookupEndpointsOmitsV1WhenTrusted(t *testing.T) {
+	s := &Service{Config: &ServiceConfig{}}
+
+	endpoints, err := s.lookupEndpoints(DefaultNamespace+"/library/busybox", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, endpoint := range endpoints {
+		if endpoint.Version == APIVersion1 {
+			t.Fatalf("expected no v1 endpoints for a trusted lookup, got %v", endpoints)
+		}
+		if !endpoint.Trusted {
+			t.Fatalf("expected every endpoint to be marked Trusted, got %v", endpoint)
+		}
+	}
+}
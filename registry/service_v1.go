@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"log"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"github.com/docker/docker/pkg/progress"
+	"github.com/docker/docker/pkg/tlsconfig"
+)
+
+// lookupV1Endpoints returns the v1 API endpoints to try for repoName, in
+// order of preference: the registry itself, HTTPS before plain HTTP.
+// Callers must not invoke this when s.Config.V2Only is set.
+func (s *Service) lookupV1Endpoints(repoName string, logger *log.Logger) (endpoints []APIEndpoint, err error) {
+	if strings.HasPrefix(repoName, DefaultNamespace+"/") {
+		if runtime.GOOS != "linux" { // do not inherit legacy API for OSes supported in the future
+			return nil, nil
+		}
+		var cfg = tlsconfig.ServerDefault
+		v1registryURL, err := url.Parse(DefaultV1Registry)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("endpoints append default v1 registry: %v", DefaultV1Registry)
+		endpoints = append(endpoints, APIEndpoint{
+			URL:          v1registryURL,
+			Version:      APIVersion1,
+			Official:     true,
+			TrimHostname: true,
+			TLSConfig:    &cfg,
+		})
+		return endpoints, nil
+	}
+
+	hostname, err := hostnameFromRepoName(repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := s.TLSConfig(hostname)
+	if err != nil {
+		return nil, err
+	}
+	isSecure := !tlsConfig.InsecureSkipVerify
+
+	httpsURL, err := buildEndpointURL("https", hostname)
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("endpoints append secure registry: %v", httpsURL)
+	endpoints = append(endpoints, APIEndpoint{
+		URL:          httpsURL,
+		Version:      APIVersion1,
+		TrimHostname: true,
+		TLSConfig:    tlsConfig,
+	})
+
+	if !isSecure {
+		httpURL, err := buildEndpointURL("http", hostname)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("endpoints append insecure registry: %v", httpURL)
+		endpoints = append(endpoints, APIEndpoint{
+			URL:          httpURL,
+			Version:      APIVersion1,
+			TrimHostname: true,
+			// used to check if supposed to be secure via InsecureSkipVerify
+			TLSConfig: tlsConfig,
+		})
+	}
+
+	return endpoints, nil
+}
+
+// WarnOnV1Registry writes a deprecation warning to out when an image is
+// actually pulled from a legacy v1 endpoint, so that users relying on v1
+// registries notice before support for the protocol is removed.
+func WarnOnV1Registry(endpoint APIEndpoint, out progress.Output) {
+	if endpoint.Version != APIVersion1 {
+		return
+	}
+	progress.Message(out, "", "Warning: pulling from a legacy v1 registry. This protocol is deprecated and will be removed in a future release. Please contact the registry operator to upgrade to a v2 registry.")
+}
@@ -0,0 +1,30 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/docker/docker/pkg/progress"
+)
+
+type fakeProgressOutput struct {
+	messages []progress.Progress
+}
+
+func (f *fakeProgressOutput) WriteProgress(p progress.Progress) error {
+	f.messages = append(f.messages, p)
+	return nil
+}
+
+func TestWarnOnV1RegistryOnlyWarnsForV1(t *testing.T) {
+	out := &fakeProgressOutput{}
+
+	WarnOnV1Registry(APIEndpoint{Version: APIVersion2}, out)
+	if len(out.messages) != 0 {
+		t.Fatalf("expected no warning for a v2 endpoint, got %v", out.messages)
+	}
+
+	WarnOnV1Registry(APIEndpoint{Version: APIVersion1}, out)
+	if len(out.messages) != 1 {
+		t.Fatalf("expected exactly one warning for a v1 endpoint, got %v", out.messages)
+	}
+}
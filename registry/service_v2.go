@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/docker/pkg/tlsconfig"
+)
+
+// v2Versions is the API version header advertised by this client when
+// probing a v2 registry.
+var v2Versions = []auth.APIVersion{
+	{
+		Type:    "registry",
+		Version: "2.0",
+	},
+}
+
+// lookupV2Endpoints returns the v2 API endpoints to try for repoName, in
+// order of preference: mirrors first (ranked by s.Config.MirrorSelector),
+// then the registry itself, HTTPS before plain HTTP.
+func (s *Service) lookupV2Endpoints(repoName string, logger *log.Logger) (endpoints []APIEndpoint, err error) {
+	isOfficial := strings.HasPrefix(repoName, DefaultNamespace+"/")
+
+	mirrorHostname := DefaultNamespace
+	if !isOfficial {
+		mirrorHostname, err = hostnameFromRepoName(repoName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, mirror := range s.mirrorsFor(mirrorHostname) {
+		mirrorURL, err := url.Parse(mirror)
+		if err != nil {
+			return nil, err
+		}
+		mirrorTLSConfig, err := s.tlsConfigForMirror(mirrorURL)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Printf("endpoints append mirror: %v", mirror)
+		endpoints = append(endpoints, APIEndpoint{
+			URL: mirrorURL,
+			// guess mirrors are v2
+			Version:      APIVersion2,
+			Mirror:       true,
+			TrimHostname: true,
+			TLSConfig:    mirrorTLSConfig,
+		})
+	}
+
+	if isOfficial {
+		var cfg = tlsconfig.ServerDefault
+		v2registryURL, err := url.Parse(DefaultV2Registry)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("endpoints append default v2 registry: %v", DefaultV2Registry)
+		endpoints = append(endpoints, APIEndpoint{
+			URL:          v2registryURL,
+			Version:      APIVersion2,
+			Official:     true,
+			TrimHostname: true,
+			TLSConfig:    &cfg,
+		})
+		return endpoints, nil
+	}
+
+	hostname := mirrorHostname
+
+	tlsConfig, err := s.TLSConfig(hostname)
+	if err != nil {
+		return nil, err
+	}
+	isSecure := !tlsConfig.InsecureSkipVerify
+
+	httpsURL, err := buildEndpointURL("https", hostname)
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("endpoints append secure registry: %v", httpsURL)
+	endpoints = append(endpoints, APIEndpoint{
+		URL:           httpsURL,
+		Version:       APIVersion2,
+		TrimHostname:  true,
+		TLSConfig:     tlsConfig,
+		VersionHeader: DefaultRegistryVersionHeader,
+		Versions:      v2Versions,
+	})
+
+	if !isSecure {
+		httpURL, err := buildEndpointURL("http", hostname)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("endpoints append insecure registry: %v", httpURL)
+		endpoints = append(endpoints, APIEndpoint{
+			URL:          httpURL,
+			Version:      APIVersion2,
+			TrimHostname: true,
+			// used to check if supposed to be secure via InsecureSkipVerify
+			TLSConfig:     tlsConfig,
+			VersionHeader: DefaultRegistryVersionHeader,
+			Versions:      v2Versions,
+		})
+	}
+
+	return endpoints, nil
+}
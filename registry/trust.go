@@ -0,0 +1,153 @@
+package registry
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/distribution/digest"
+	"github.com/docker/docker/reference"
+	"github.com/docker/notary/client"
+	"github.com/docker/notary/passphrase"
+	"github.com/docker/notary/trustpinning"
+	"github.com/docker/notary/tuf/data"
+)
+
+// NotaryServer is the Notary server trusted for the official registry.
+const NotaryServer = "https://notary.docker.io"
+
+// TrustError wraps an error encountered while resolving or publishing
+// trust data, with enough context for a user to act on it. The
+// underlying Notary client surfaces bare TUF/JSON errors that are
+// meaningless on their own without knowing which reference and
+// operation triggered them.
+type TrustError struct {
+	Op  string
+	Ref string
+	Err error
+}
+
+func (e *TrustError) Error() string {
+	return fmt.Sprintf("error %s trust data for %s: %s", e.Op, e.Ref, e.Err)
+}
+
+// wrapTrustError translates the errors the Notary client returns (bare
+// JSON decode failures, TUF expiration) into TrustError values carrying a
+// message an end user can act on, instead of the raw library error.
+func wrapTrustError(op string, ref reference.Named, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch err.(type) {
+	case *json.SyntaxError:
+		err = fmt.Errorf("received corrupt trust data from the registry or notary server")
+	case client.ErrExpired:
+		err = fmt.Errorf("trust data has expired, the repository owner needs to re-sign")
+	}
+	return &TrustError{Op: op, Ref: ref.String(), Err: err}
+}
+
+// notaryServerFor returns the Notary server URL to contact for endpoint.
+// Callers must not pass a Mirror endpoint here: a mirror has no Notary
+// server of its own, and deriving one from the mirror's own host would
+// point trust lookups at the wrong server entirely. lookupEndpoints
+// never marks a Mirror endpoint Trusted for this reason.
+func notaryServerFor(endpoint APIEndpoint) string {
+	if endpoint.Official {
+		return NotaryServer
+	}
+
+	// Private registries are expected to run their Notary server
+	// alongside the registry itself, on the well-known notary port.
+	return "https://" + endpoint.URL.Hostname() + ":4443"
+}
+
+// TrustedEndpoint returns the Notary server URL and TLS configuration to
+// use for trust operations against endpoint's registry. It reuses the
+// same per-host cert directory lookup as s.TLSConfig so Notary presents
+// the same client certificate as the registry itself.
+func (s *Service) TrustedEndpoint(endpoint APIEndpoint) (string, *tls.Config, error) {
+	tlsConfig, err := s.TLSConfig(endpoint.URL.Host)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return notaryServerFor(endpoint), tlsConfig, nil
+}
+
+func (s *Service) notaryRepository(endpoint APIEndpoint, ref reference.Named) (*client.NotaryRepository, error) {
+	server, tlsConfig, err := s.TrustedEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := &http.Transport{TLSClientConfig: tlsConfig}
+	return client.NewNotaryRepository(
+		s.Config.TrustBaseDir,
+		ref.Name(),
+		server,
+		rt,
+		passphrase.PromptRetriever(),
+		trustpinning.TrustPinConfig{},
+	)
+}
+
+// ResolveTrustedReference looks up the digest and size signed for ref's
+// tag in Notary, so a trusted pull can fetch the exact content the
+// publisher signed rather than whatever the registry currently serves
+// under that tag.
+func (s *Service) ResolveTrustedReference(endpoint APIEndpoint, ref reference.Named) (digest.Digest, int64, error) {
+	tagged, isTagged := ref.(reference.NamedTagged)
+	if !isTagged {
+		return "", 0, fmt.Errorf("%s is not a tagged reference", ref.String())
+	}
+
+	repo, err := s.notaryRepository(endpoint, ref)
+	if err != nil {
+		return "", 0, wrapTrustError("resolving", ref, err)
+	}
+
+	target, err := repo.GetTargetByName(tagged.Tag())
+	if err != nil {
+		return "", 0, wrapTrustError("resolving", ref, err)
+	}
+
+	hashHex, ok := target.Hashes["sha256"]
+	if !ok {
+		return "", 0, wrapTrustError("resolving", ref, fmt.Errorf("no sha256 hash published for tag %q", tagged.Tag()))
+	}
+
+	return digest.NewDigestFromHex("sha256", hex.EncodeToString(hashHex)), target.Length, nil
+}
+
+// SignTaggedReference publishes dgst and size as the signed target for
+// ref's tag in Notary, so that subsequent trusted pulls can verify the
+// content pushed here.
+func (s *Service) SignTaggedReference(endpoint APIEndpoint, ref reference.Named, dgst digest.Digest, size int64) error {
+	tagged, isTagged := ref.(reference.NamedTagged)
+	if !isTagged {
+		return fmt.Errorf("%s is not a tagged reference", ref.String())
+	}
+
+	repo, err := s.notaryRepository(endpoint, ref)
+	if err != nil {
+		return wrapTrustError("signing", ref, err)
+	}
+
+	hashBytes, err := hex.DecodeString(dgst.Hex())
+	if err != nil {
+		return wrapTrustError("signing", ref, err)
+	}
+
+	target := &client.Target{
+		Name:   tagged.Tag(),
+		Hashes: data.Hashes{"sha256": hashBytes},
+		Length: size,
+	}
+	if err := repo.AddTarget(target, data.CanonicalTargetsRole); err != nil {
+		return wrapTrustError("signing", ref, err)
+	}
+	return repo.Publish()
+}
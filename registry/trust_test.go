@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/docker/notary/client"
+)
+
+type fakeNamedRef string
+
+func (f fakeNamedRef) String() string { return string(f) }
+func (f fakeNamedRef) Name() string   { return string(f) }
+
+func TestWrapTrustError(t *testing.T) {
+	ref := fakeNamedRef("example.com/foo:latest")
+
+	cases := []struct {
+		name    string
+		err     error
+		wantMsg string
+	}{
+		{"syntax error", &json.SyntaxError{}, "corrupt trust data"},
+		{"expired", client.ErrExpired{}, "expired"},
+		{"generic", fmt.Errorf("connection refused"), "connection refused"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := wrapTrustError("resolving", ref, c.err)
+
+			trustErr, ok := err.(*TrustError)
+			if !ok {
+				t.Fatalf("expected a *TrustError, got %T", err)
+			}
+			if trustErr.Ref != ref.String() {
+				t.Fatalf("expected ref %q, got %q", ref.String(), trustErr.Ref)
+			}
+			if !strings.Contains(trustErr.Error(), c.wantMsg) {
+				t.Fatalf("expected error %q to mention %q", trustErr.Error(), c.wantMsg)
+			}
+		})
+	}
+
+	if err := wrapTrustError("resolving", ref, nil); err != nil {
+		t.Fatalf("expected a nil err to wrap to nil, got %v", err)
+	}
+}
+
+func TestNotaryServerFor(t *testing.T) {
+	mirrorURL, err := url.Parse("https://mirror.example.com:5000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	official := APIEndpoint{Official: true, URL: mirrorURL}
+	if got := notaryServerFor(official); got != NotaryServer {
+		t.Fatalf("expected official endpoints to use %q, got %q", NotaryServer, got)
+	}
+
+	private := APIEndpoint{URL: mirrorURL}
+	if want, got := "https://mirror.example.com:4443", notaryServerFor(private); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}